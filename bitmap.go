@@ -0,0 +1,209 @@
+package main
+
+import (
+	"math/big"
+	"math/bits"
+	"net"
+)
+
+// maxBitmapAddresses bounds how large a subnet's bitmap is allowed to grow
+// in memory/storage. Subnets larger than this (e.g. an IPv6 /64 or bigger)
+// fall back to randomized-probe allocation instead of a full bitmap.
+const maxBitmapAddresses = 1 << 24 // 16M addresses (~2MB bitmap)
+
+// maxProbeAttempts bounds how many random offsets we'll try before giving up
+// on a randomized-probe allocation.
+const maxProbeAttempts = 32
+
+// subnetState is the in-memory view of a subnets row used while allocating
+// or releasing an address. It's deliberately storage-agnostic so both the
+// SQLite and PostgreSQL stores can share the bitmap math.
+type subnetState struct {
+	id        int64
+	network   *net.IPNet
+	total     *big.Int
+	bitmap    []byte
+	highWater uint64
+	probeMode bool
+}
+
+// addressCount returns the number of addresses in ipNet as a big.Int, since
+// an IPv6 /64 (or smaller prefix) does not fit in a uint64.
+func addressCount(ipNet *net.IPNet) *big.Int {
+	ones, bits := ipNet.Mask.Size()
+	count := big.NewInt(1)
+	count.Lsh(count, uint(bits-ones))
+	return count
+}
+
+// usesProbeMode reports whether a subnet of this size should allocate via
+// randomized probing rather than a full bitmap.
+func usesProbeMode(ipNet *net.IPNet) bool {
+	return addressCount(ipNet).Cmp(big.NewInt(maxBitmapAddresses)) > 0
+}
+
+// reservedOffsets returns the offsets (relative to the network address) that
+// must never be handed out for a CIDR of this size: the network and
+// broadcast addresses for IPv4, and offset 0 (subnet-router anycast) for
+// IPv6.
+func reservedOffsets(ipNet *net.IPNet) (first, last *big.Int) {
+	total := addressCount(ipNet)
+	if ip4 := ipNet.IP.To4(); ip4 != nil {
+		return big.NewInt(1), new(big.Int).Sub(total, big.NewInt(2)) // skip network (0) and broadcast (total-1)
+	}
+	// IPv6: skip the subnet-router anycast address (offset 0); there is no
+	// broadcast address to reserve at the top of the range.
+	return big.NewInt(1), new(big.Int).Sub(total, big.NewInt(1))
+}
+
+// bitSet reports whether offset is set in bitmap.
+func bitSet(bitmap []byte, offset uint64) bool {
+	byteIdx := offset / 8
+	if byteIdx >= uint64(len(bitmap)) {
+		return false
+	}
+	return bitmap[byteIdx]&(1<<(offset%8)) != 0
+}
+
+// setBit flips offset on in bitmap, growing it if necessary.
+func setBit(bitmap []byte, offset uint64) []byte {
+	byteIdx := offset / 8
+	if byteIdx >= uint64(len(bitmap)) {
+		grown := make([]byte, byteIdx+1)
+		copy(grown, bitmap)
+		bitmap = grown
+	}
+	bitmap[byteIdx] |= 1 << (offset % 8)
+	return bitmap
+}
+
+// clearBit flips offset off in bitmap.
+func clearBit(bitmap []byte, offset uint64) []byte {
+	byteIdx := offset / 8
+	if byteIdx >= uint64(len(bitmap)) {
+		return bitmap
+	}
+	bitmap[byteIdx] &^= 1 << (offset % 8)
+	return bitmap
+}
+
+// addOffset returns a new net.IP equal to network plus offset, supporting
+// both IPv4 (32-bit) and IPv6 (128-bit) arithmetic via big.Int. It does not
+// mutate its argument and can add any offset, not just one.
+func addOffset(network net.IP, offset *big.Int) net.IP {
+	is4 := network.To4() != nil
+	base := new(big.Int).SetBytes(normalizeIP(network))
+	base.Add(base, offset)
+
+	width := 4
+	if !is4 {
+		width = 16
+	}
+	out := base.Bytes()
+	if len(out) < width {
+		padded := make([]byte, width)
+		copy(padded[width-len(out):], out)
+		out = padded
+	}
+	return net.IP(out)
+}
+
+// normalizeIP returns ip as a 4-byte slice for IPv4 or a 16-byte slice for
+// IPv6, so big.Int.SetBytes operates on a consistent width.
+func normalizeIP(ip net.IP) []byte {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// scanForFreeOffset finds the first zero bit at or past the subnet's
+// high-water mark, giving O(1) amortized allocation for the common
+// sequential-fill case.
+func scanForFreeOffset(state *subnetState, firstOffset, lastOffset *big.Int) (*big.Int, error) {
+	if lastOffset.Cmp(firstOffset) < 0 {
+		// Degenerate case: a /32 (or /31) has no usable host offset at all.
+		// For a /32, lastOffset went negative computing total-2, and
+		// lastOffset.Uint64() below would silently wrap it into a huge value.
+		return nil, errNoAvailableIP
+	}
+
+	start := state.highWater
+	if start < firstOffset.Uint64() {
+		start = firstOffset.Uint64()
+	}
+	last := lastOffset.Uint64()
+
+	for offset := start; offset <= last; offset++ {
+		if !bitSet(state.bitmap, offset) {
+			return big.NewInt(int64(offset)), nil
+		}
+	}
+	// Wrapped past the high-water mark without finding a gap; fall back to
+	// scanning from the beginning in case earlier addresses were released.
+	for offset := firstOffset.Uint64(); offset < start; offset++ {
+		if !bitSet(state.bitmap, offset) {
+			return big.NewInt(int64(offset)), nil
+		}
+	}
+	return nil, errNoAvailableIP
+}
+
+// probeForFreeOffset picks random offsets within [firstOffset, lastOffset]
+// and retries on collision, avoiding the memory cost of a full bitmap and
+// the predictability of sequential allocation on large IPv6 ranges. Probe
+// offsets routinely exceed 64 bits, so collisions can't be checked against a
+// bitmap (which would need offset.Uint64() and silently truncate); taken
+// reports whether a candidate offset is already allocated, typically by
+// looking up the corresponding address in the ips table.
+func probeForFreeOffset(firstOffset, lastOffset *big.Int, taken func(offset *big.Int) (bool, error)) (*big.Int, error) {
+	span := new(big.Int).Sub(lastOffset, firstOffset)
+	span.Add(span, big.NewInt(1))
+	if span.Sign() <= 0 {
+		return nil, errNoAvailableIP
+	}
+
+	for attempt := 0; attempt < maxProbeAttempts; attempt++ {
+		randOffset, err := cryptoRandInt(span)
+		if err != nil {
+			return nil, err
+		}
+		offset := new(big.Int).Add(firstOffset, randOffset)
+		isTaken, err := taken(offset)
+		if err != nil {
+			return nil, err
+		}
+		if !isTaken {
+			return offset, nil
+		}
+	}
+	return nil, errTooManyProbes
+}
+
+// countSetBits returns how many bits in bitmap are set, i.e. how many
+// addresses in the subnet are currently allocated.
+func countSetBits(bitmap []byte) uint64 {
+	var count uint64
+	for _, b := range bitmap {
+		count += uint64(bits.OnesCount8(b))
+	}
+	return count
+}
+
+// ipOffset returns how far ip sits past network, as an offset suitable for
+// the allocation bitmap.
+func ipOffset(ip, network net.IP) uint64 {
+	offset := new(big.Int).Sub(new(big.Int).SetBytes(normalizeIP(ip)), new(big.Int).SetBytes(normalizeIP(network)))
+	return offset.Uint64()
+}
+
+// freeOffset picks an offset to allocate from state, using a full bitmap
+// scan or randomized probing depending on how the subnet was sized. taken is
+// only consulted in probe mode; see probeForFreeOffset.
+func freeOffset(state *subnetState, ipNet *net.IPNet, taken func(offset *big.Int) (bool, error)) (*big.Int, error) {
+	firstOffset, lastOffset := reservedOffsets(ipNet)
+	if state.probeMode {
+		return probeForFreeOffset(firstOffset, lastOffset, taken)
+	}
+	return scanForFreeOffset(state, firstOffset, lastOffset)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	errNoAvailableIP       = errors.New("no available IP in the given CIDR")
+	errTooManyProbes       = fmt.Errorf("no available IP found after %d random probes", maxProbeAttempts)
+	errPurposeAddressTaken = errors.New("the address for this purpose is already reserved")
+)
+
+// cryptoRandInt returns a uniform random value in [0, max) using a
+// cryptographically secure source, so IPv6 probe allocation isn't
+// predictable.
+func cryptoRandInt(max *big.Int) (*big.Int, error) {
+	return rand.Int(rand.Reader, max)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// lockManager hands out a *sync.Mutex per CIDR, so concurrent requests
+// against different subnets don't serialize behind each other the way the
+// old single package-level mutex did. Locks are created lazily and kept for
+// the life of the process.
+type lockManager struct {
+	mu    sync.RWMutex
+	locks map[string]*sync.Mutex
+}
+
+func newLockManager() *lockManager {
+	return &lockManager{locks: make(map[string]*sync.Mutex)}
+}
+
+// Lock acquires the mutex for key (creating it if necessary) and returns a
+// function that releases it.
+func (lm *lockManager) Lock(key string) func() {
+	lm.mu.RLock()
+	m, ok := lm.locks[key]
+	lm.mu.RUnlock()
+
+	if !ok {
+		lm.mu.Lock()
+		m, ok = lm.locks[key]
+		if !ok {
+			m = &sync.Mutex{}
+			lm.locks[key] = m
+		}
+		lm.mu.Unlock()
+	}
+
+	m.Lock()
+	return m.Unlock
+}
+
+// isUniqueConstraintError reports whether err came from violating a UNIQUE
+// constraint. We match on the driver-returned message rather than a
+// driver-specific error type so this keeps working once Store gains a
+// PostgreSQL implementation alongside SQLite.
+func isUniqueConstraintError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique constraint")
+}
@@ -1,37 +1,39 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"strings"
-	"sync"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var (
-	db    *sql.DB
-	mutex sync.Mutex
-)
+var store Store
 
 func main() {
 	var err error
-	db, err = sql.Open("sqlite3", "ip_database.db")
+	store, err = NewStore()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer store.Close()
 
-	createIPTable()
+	prometheus.MustRegister(newSubnetUtilizationCollector())
 
-	http.HandleFunc("/reserve-ip", ReserveIPHandler)
-	http.HandleFunc("/release-ip", ReleaseIPHandler)
-	http.HandleFunc("/get-ips-in-subnet", GetIPsInSubnetHandler)
+	http.HandleFunc("/reserve-ip", withLoggingAndMetrics("/reserve-ip", ReserveIPHandler))
+	http.HandleFunc("/reserve-range", withLoggingAndMetrics("/reserve-range", ReserveRangeHandler))
+	http.HandleFunc("/release-ip", withLoggingAndMetrics("/release-ip", ReleaseIPHandler))
+	http.HandleFunc("/get-ips-in-subnet", withLoggingAndMetrics("/get-ips-in-subnet", GetIPsInSubnetHandler))
+	http.HandleFunc("/ip/", withLoggingAndMetrics("/ip/", GetIPHandler))
+	http.HandleFunc("/subnets", SubnetsHandler)
+	http.HandleFunc("/subnets/", SubnetByIDHandler)
+	http.Handle("/metrics", promhttp.Handler())
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -41,25 +43,9 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
-func createIPTable() {
-	createTable := `
-		CREATE TABLE IF NOT EXISTS ips (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			cidr TEXT,
-			tenant_name TEXT,
-			ip_address TEXT,
-			purpose TEXT,
-			UNIQUE (cidr, tenant_name, ip_address)
-		)`
-	_, err := db.Exec(createTable)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
 func ReserveIPHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 		return
 	}
 
@@ -71,18 +57,26 @@ func ReserveIPHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&requestPayload)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request payload")
 		return
 	}
+	if !isValidPurpose(requestPayload.Purpose) {
+		writeError(w, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("Invalid purpose %q", requestPayload.Purpose))
+		return
+	}
+	setRequestTenantCIDR(r.Context(), requestPayload.TenantName, requestPayload.CIDR)
 
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	ip, reserved, err := reserveIP(requestPayload.CIDR, requestPayload.TenantName, requestPayload.Purpose)
+	ip, reserved, err := store.ReserveIP(r.Context(), requestPayload.CIDR, requestPayload.TenantName, requestPayload.Purpose)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error reserving IP: %s", err.Error()), http.StatusInternalServerError)
+		reservationsTotal.WithLabelValues(requestPayload.TenantName, requestPayload.CIDR, "error").Inc()
+		if errors.Is(err, errPurposeAddressTaken) {
+			writeError(w, http.StatusConflict, "purpose_address_taken", fmt.Sprintf("Error reserving IP: %s", err.Error()))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "reservation_failed", fmt.Sprintf("Error reserving IP: %s", err.Error()))
 		return
 	}
+	reservationsTotal.WithLabelValues(requestPayload.TenantName, requestPayload.CIDR, "success").Inc()
 
 	response := struct {
 		IPAddress string `json:"ip_address"`
@@ -94,7 +88,7 @@ func ReserveIPHandler(w http.ResponseWriter, r *http.Request) {
 
 	responseJSON, err := json.Marshal(response)
 	if err != nil {
-		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "encoding_failed", "Error encoding JSON")
 		return
 	}
 
@@ -103,29 +97,9 @@ func ReserveIPHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(responseJSON)
 }
 
-func reserveIP(cidr, tenantName, purpose string) (string, bool, error) {
-	ip, available := findAvailableIP(cidr, tenantName)
-	if !available {
-		return "", false, fmt.Errorf("No available IP in the given CIDR")
-	}
-
-	// Check if the IP is already reserved
-	if isIPReserved(ip, cidr, tenantName) {
-		return "", false, fmt.Errorf("IP already reserved for the given CIDR and tenant")
-	}
-
-	// Reserve the IP in the database
-	_, err := db.Exec("INSERT INTO ips (cidr, tenant_name, ip_address, purpose) VALUES (?, ?, ?, ?)", cidr, tenantName, ip, purpose)
-	if err != nil {
-		return "", false, err
-	}
-
-	return ip, true, nil
-}
-
 func ReleaseIPHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 		return
 	}
 
@@ -137,15 +111,18 @@ func ReleaseIPHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&requestPayload)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request payload")
 		return
 	}
+	setRequestTenantCIDR(r.Context(), requestPayload.TenantName, requestPayload.CIDR)
 
-	success, err := releaseReservedIP(requestPayload.CIDR, requestPayload.TenantName, requestPayload.IPAddress)
+	success, err := store.ReleaseIP(r.Context(), requestPayload.CIDR, requestPayload.TenantName, requestPayload.IPAddress)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error releasing IP: %s", err.Error()), http.StatusInternalServerError)
+		releasesTotal.WithLabelValues(requestPayload.TenantName, requestPayload.CIDR, "error").Inc()
+		writeError(w, http.StatusInternalServerError, "release_failed", fmt.Sprintf("Error releasing IP: %s", err.Error()))
 		return
 	}
+	releasesTotal.WithLabelValues(requestPayload.TenantName, requestPayload.CIDR, "success").Inc()
 
 	response := struct {
 		Success bool `json:"success"`
@@ -155,7 +132,7 @@ func ReleaseIPHandler(w http.ResponseWriter, r *http.Request) {
 
 	responseJSON, err := json.Marshal(response)
 	if err != nil {
-		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "encoding_failed", "Error encoding JSON")
 		return
 	}
 
@@ -164,77 +141,15 @@ func ReleaseIPHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(responseJSON)
 }
 
-func releaseReservedIP(cidr, tenantName, ipAddress string) (bool, error) {
-	// Release the reservation in the database
-	result, err := db.Exec("DELETE FROM ips WHERE cidr = ? AND tenant_name = ? AND ip_address = ?", cidr, tenantName, ipAddress)
-	if err != nil {
-		return false, err
-	}
-
-	// Check if any row was affected
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-
-	return rowsAffected > 0, nil
-}
-
-func findAvailableIP(cidr, tenantName string) (string, bool) {
-	ip, ipNet, err := net.ParseCIDR(cidr)
-	if err != nil {
-		return "", false
-	}
-
-	// Loop through IP addresses in the CIDR range starting from the second address
-	for ip := incrementIP(ip.Mask(ipNet.Mask)); ipNet.Contains(ip); incrementIP(ip) {
-		ipString := ip.String()
-
-		// Check if IP is in the database
-		if !isIPReserved(ipString, cidr, tenantName) {
-			// IP is available
-			return ipString, true
-		}
-	}
-
-	// No available IP found
-	return "", false
-}
-
-func isIPReserved(ip, cidr, tenantName string) bool {
-	query := "SELECT ip_address FROM ips WHERE cidr = ? AND ip_address = ?"
-	if tenantName != "" {
-		query += " AND tenant_name = ?"
-	}
-	row := db.QueryRow(query, cidr, ip, tenantName)
-
-	var storedIP string
-	err := row.Scan(&storedIP)
-	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error checking database:", err)
-	}
-
-	return storedIP == ip
-}
-
-func incrementIP(ip net.IP) net.IP {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
-		}
-	}
-	return ip
-}
 func GetIPsInSubnetHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 		return
 	}
 
 	subnetQueryParam := r.URL.Query().Get("subnet")
 	if subnetQueryParam == "" {
-		http.Error(w, "Subnet parameter is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_request", "Subnet parameter is required")
 		return
 	}
 
@@ -244,9 +159,16 @@ func GetIPsInSubnetHandler(w http.ResponseWriter, r *http.Request) {
 		subnet += "/32" // Assume a single IP address if no subnet mask is provided
 	}
 
-	ips, err := getIPsInSubnet(subnet)
+	_, ipNet, err := net.ParseCIDR(subnet)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting IPs in subnet: %s", err.Error()), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, "invalid_subnet", fmt.Sprintf("Invalid subnet: %s", err.Error()))
+		return
+	}
+	setRequestTenantCIDR(r.Context(), "", ipNet.String())
+
+	ips, err := store.ListIPsInCIDR(r.Context(), ipNet.String())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "subnet_lookup_failed", fmt.Sprintf("Error getting IPs in subnet: %s", err.Error()))
 		return
 	}
 
@@ -258,7 +180,7 @@ func GetIPsInSubnetHandler(w http.ResponseWriter, r *http.Request) {
 
 	responseJSON, err := json.Marshal(response)
 	if err != nil {
-		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "encoding_failed", "Error encoding JSON")
 		return
 	}
 
@@ -267,27 +189,43 @@ func GetIPsInSubnetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(responseJSON)
 }
 
-func getIPsInSubnet(subnet string) ([]string, error) {
-	ip, ipNet, err := net.ParseCIDR(subnet)
+// GetIPHandler handles GET /ip/{cidr}/{ip}, reporting whether ip is
+// currently reserved in cidr. cidr itself may contain a "/" (its prefix
+// length), so the last path segment is taken as the IP and everything
+// before it is rejoined as the CIDR.
+func GetIPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/ip/")
+	segments := strings.Split(path, "/")
+	if len(segments) < 2 || segments[len(segments)-1] == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Expected path /ip/{cidr}/{ip}")
+		return
+	}
+	ipAddress := segments[len(segments)-1]
+	cidr := strings.Join(segments[:len(segments)-1], "/")
+
+	_, ipNet, err := net.ParseCIDR(cidr)
 	if err != nil {
-		return nil, err
+		writeError(w, http.StatusBadRequest, "invalid_subnet", fmt.Sprintf("Invalid CIDR: %s", err.Error()))
+		return
 	}
-	if ip != nil {}
-	rows, err := db.Query("SELECT ip_address FROM ips WHERE cidr = ?", ipNet.String())
+	setRequestTenantCIDR(r.Context(), "", ipNet.String())
+
+	exists, err := store.IPExists(r.Context(), ipNet.String(), ipAddress)
 	if err != nil {
-		return nil, err
+		writeError(w, http.StatusInternalServerError, "ip_lookup_failed", fmt.Sprintf("Error checking IP reservation: %s", err.Error()))
+		return
 	}
-	defer rows.Close()
-
-	var ips []string
-	for rows.Next() {
-		var ipAddress string
-		err := rows.Scan(&ipAddress)
-		if err != nil {
-			return nil, err
-		}
-		ips = append(ips, ipAddress)
+	if !exists {
+		writeError(w, http.StatusNotFound, "ip_not_found", fmt.Sprintf("%s is not reserved in %s", ipAddress, cidr))
+		return
 	}
 
-	return ips, nil
-}
\ No newline at end of file
+	writeJSON(w, http.StatusOK, struct {
+		Reserved bool `json:"reserved"`
+	}{Reserved: true})
+}
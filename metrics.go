@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "request_id"
+	logFieldsKey contextKey = "log_fields"
+)
+
+// requestLogFields holds the tenant/cidr a handler is operating on, set
+// after it decodes the request (the middleware that logs them runs before
+// the handler does). It's stored behind a pointer so the handler can fill
+// it in on the same context value the middleware already holds.
+type requestLogFields struct {
+	tenant string
+	cidr   string
+}
+
+// setRequestTenantCIDR records tenant/cidr on ctx's requestLogFields, if the
+// request went through withLoggingAndMetrics. Handlers call this right
+// after decoding their request payload so the access log line below can
+// report what the request was actually for.
+func setRequestTenantCIDR(ctx context.Context, tenant, cidr string) {
+	if fields, ok := ctx.Value(logFieldsKey).(*requestLogFields); ok {
+		fields.tenant = tenant
+		fields.cidr = cidr
+	}
+}
+
+var (
+	reservationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipam_reservations_total",
+		Help: "Total number of IP reservation attempts.",
+	}, []string{"tenant", "cidr", "result"})
+
+	releasesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipam_releases_total",
+		Help: "Total number of IP release attempts.",
+	}, []string{"tenant", "cidr", "result"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ipam_http_request_duration_seconds",
+		Help: "HTTP request duration in seconds, by route.",
+	}, []string{"route", "method", "status"})
+)
+
+// newRequestID generates a short random hex id to correlate a request's
+// access log line with any slow-query lines the store layer emits for it.
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// statusRecorder captures the status code a handler writes, so the
+// middleware can log and instrument it after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withLoggingAndMetrics wraps next with structured request logging and
+// Prometheus request-duration instrumentation, generating a request_id and
+// threading it through the request's context so store calls can tag their
+// own slow-query logs with it.
+func withLoggingAndMetrics(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := newRequestID()
+		fields := &requestLogFields{}
+		ctx := context.WithValue(withRequestID(r.Context(), requestID), logFieldsKey, fields)
+		r = r.WithContext(ctx)
+
+		remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remoteIP = r.RemoteAddr
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next(rec, r)
+		duration := time.Since(start)
+
+		httpRequestDuration.WithLabelValues(route, r.Method, http.StatusText(rec.status)).Observe(duration.Seconds())
+
+		logLine, err := json.Marshal(map[string]interface{}{
+			"request_id":  requestID,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"remote_ip":   remoteIP,
+			"tenant":      fields.tenant,
+			"cidr":        fields.cidr,
+			"status":      rec.status,
+			"duration_ms": duration.Milliseconds(),
+		})
+		if err == nil {
+			log.Println(string(logLine))
+		}
+	}
+}
+
+// subnetUtilizationCollector is a Prometheus collector that recomputes
+// ipam_subnet_utilization from the store on every scrape, rather than
+// keeping a gauge in sync on every reservation.
+type subnetUtilizationCollector struct {
+	desc *prometheus.Desc
+}
+
+func newSubnetUtilizationCollector() *subnetUtilizationCollector {
+	return &subnetUtilizationCollector{
+		desc: prometheus.NewDesc("ipam_subnet_utilization", "Fraction of a subnet's addresses currently allocated.", []string{"cidr"}, nil),
+	}
+}
+
+func (c *subnetUtilizationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *subnetUtilizationCollector) Collect(ch chan<- prometheus.Metric) {
+	utilizations, err := store.SubnetUtilization(context.Background())
+	if err != nil {
+		log.Printf("collecting subnet utilization: %v", err)
+		return
+	}
+	for _, u := range utilizations {
+		if u.Total == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(u.Used)/u.Total, u.CIDR)
+	}
+}
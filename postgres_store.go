@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresStore is the multi-instance Store backend. Unlike sqliteStore it
+// has no in-process lock: every instance behind the load balancer shares
+// the same database, so the reservation critical section is serialized
+// with `SELECT ... FOR UPDATE` on the subnets row instead.
+type postgresStore struct {
+	db *sql.DB
+}
+
+func newPostgresStore(dsn string) (*postgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &postgresStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *postgresStore) migrate() error {
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ips (
+			id SERIAL PRIMARY KEY,
+			cidr TEXT,
+			tenant_name TEXT,
+			ip_address TEXT,
+			purpose TEXT,
+			UNIQUE (cidr, tenant_name, ip_address)
+		)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS subnets (
+			id SERIAL PRIMARY KEY,
+			parent_id INTEGER,
+			cidr TEXT NOT NULL,
+			tenant_name TEXT NOT NULL,
+			description TEXT,
+			bitmap BYTEA,
+			high_water BIGINT NOT NULL DEFAULT 0,
+			probe_mode BOOLEAN NOT NULL DEFAULT FALSE,
+			UNIQUE (cidr, tenant_name)
+		)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ip_ranges (
+			id SERIAL PRIMARY KEY,
+			cidr TEXT NOT NULL,
+			tenant_name TEXT NOT NULL,
+			start_ip TEXT NOT NULL,
+			end_ip TEXT NOT NULL,
+			description TEXT
+		)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_ips_cidr_tenant ON ips (cidr, tenant_name)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_ips_ip_address ON ips (ip_address)`); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *postgresStore) ReserveIP(ctx context.Context, cidr, tenantName, purpose string) (string, bool, error) {
+	defer logIfSlow(ctx, "ReserveIP", time.Now())
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", false, err
+	}
+
+	var (
+		id          int64
+		bitmap      []byte
+		highWater   uint64
+		storedProbe bool
+	)
+	row := tx.QueryRowContext(ctx, "SELECT id, bitmap, high_water, probe_mode FROM subnets WHERE cidr = $1 AND tenant_name = $2 FOR UPDATE", cidr, tenantName)
+	if err := row.Scan(&id, &bitmap, &highWater, &storedProbe); err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, fmt.Errorf("CIDR %s is not registered for tenant %q; register it with POST /subnets first", cidr, tenantName)
+		}
+		return "", false, err
+	}
+
+	state := &subnetState{id: id, network: ipNet, total: addressCount(ipNet), bitmap: bitmap, highWater: highWater, probeMode: storedProbe}
+	offset, err := offsetForReservation(state, ipNet, purpose, func(offset *big.Int) (bool, error) {
+		return s.offsetTaken(ctx, tx, cidr, state, ipNet, offset)
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	// Probe-mode subnets never get a bitmap: their offsets routinely exceed
+	// what offset.Uint64() can hold, and offsetTaken already consulted the
+	// ips table directly above.
+	if !state.probeMode {
+		offsetU64 := offset.Uint64()
+		byteIdx := offsetU64 / 8
+		grew := byteIdx >= uint64(len(state.bitmap))
+		state.bitmap = setBit(state.bitmap, offsetU64)
+		if offsetU64 >= state.highWater {
+			state.highWater = offsetU64 + 1
+		}
+
+		if err := s.persistBitAllocation(ctx, tx, state, byteIdx, grew); err != nil {
+			return "", false, err
+		}
+	}
+
+	ip := addOffset(ipNet.IP, offset)
+	ipString := ip.String()
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO ips (cidr, tenant_name, ip_address, purpose) VALUES ($1, $2, $3, $4)", cidr, tenantName, ipString, purpose); err != nil {
+		return "", false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", false, err
+	}
+
+	return ipString, true, nil
+}
+
+// persistBitAllocation writes state's bitmap/high_water back after a single
+// bit was set. When the bit fell within the bitmap's previous length
+// (!grew), only that one byte changed, so it's updated in place with
+// set_byte rather than rewriting the whole bytea — a heavily-used /8 would
+// otherwise push ~2MB over the wire on every single reservation. grew is
+// only true the first time an allocation reaches a byte nobody has touched
+// before, which still requires writing the (now longer) bitmap in full.
+func (s *postgresStore) persistBitAllocation(ctx context.Context, tx *sql.Tx, state *subnetState, byteIdx uint64, grew bool) error {
+	if grew {
+		_, err := tx.ExecContext(ctx, "UPDATE subnets SET bitmap = $1, high_water = $2 WHERE id = $3", state.bitmap, state.highWater, state.id)
+		return err
+	}
+	_, err := tx.ExecContext(ctx,
+		"UPDATE subnets SET bitmap = set_byte(bitmap, $1, $2), high_water = $3 WHERE id = $4",
+		int64(byteIdx), int(state.bitmap[byteIdx]), state.highWater, state.id)
+	return err
+}
+
+// offsetTaken reports whether offset is already allocated in ipNet. For
+// bitmap-backed subnets that's a cheap in-memory bit check; for probe-mode
+// subnets, which carry no bitmap, it queries the ips table for the address
+// offset maps to.
+func (s *postgresStore) offsetTaken(ctx context.Context, tx *sql.Tx, cidr string, state *subnetState, ipNet *net.IPNet, offset *big.Int) (bool, error) {
+	if !state.probeMode {
+		return bitSet(state.bitmap, offset.Uint64()), nil
+	}
+
+	candidate := addOffset(ipNet.IP, offset).String()
+	var exists int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM ips WHERE cidr = $1 AND ip_address = $2 LIMIT 1", cidr, candidate).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *postgresStore) ReleaseIP(ctx context.Context, cidr, tenantName, ipAddress string) (bool, error) {
+	defer logIfSlow(ctx, "ReleaseIP", time.Now())
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM ips WHERE cidr = $1 AND tenant_name = $2 AND ip_address = $3", cidr, tenantName, ipAddress)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected > 0 {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return false, err
+		}
+		parsed := net.ParseIP(ipAddress)
+		if parsed == nil {
+			return false, fmt.Errorf("invalid IP address: %s", ipAddress)
+		}
+
+		var (
+			id        int64
+			bitmap    []byte
+			probeMode bool
+		)
+		row := tx.QueryRowContext(ctx, "SELECT id, bitmap, probe_mode FROM subnets WHERE cidr = $1 AND tenant_name = $2 FOR UPDATE", cidr, tenantName)
+		if err := row.Scan(&id, &bitmap, &probeMode); err != nil {
+			if err != sql.ErrNoRows {
+				return false, err
+			}
+		} else if !probeMode {
+			// Probe-mode subnets carry no bitmap: their offsets are never
+			// recorded in one (see ReserveIP), so there's nothing to clear.
+			bitmap = clearBit(bitmap, ipOffset(parsed, ipNet.IP))
+			if _, err := tx.ExecContext(ctx, "UPDATE subnets SET bitmap = $1 WHERE id = $2", bitmap, id); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (s *postgresStore) ListIPsInCIDR(ctx context.Context, cidr string) ([]string, error) {
+	defer logIfSlow(ctx, "ListIPsInCIDR", time.Now())
+
+	rows, err := s.db.QueryContext(ctx, "SELECT ip_address FROM ips WHERE cidr = $1", cidr)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ipAddress string
+		if err := rows.Scan(&ipAddress); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ipAddress)
+	}
+	return ips, rows.Err()
+}
+
+// ReserveRange carves [startIP, endIP] out of cidr as a single reservation
+// (e.g. a DHCP pool), marking every offset in the range as allocated so
+// ReserveIP's scan/probe search skips them. It's only supported for
+// bitmap-backed subnets; probe-mode subnets are too large to mark a range
+// bit-by-bit.
+func (s *postgresStore) ReserveRange(ctx context.Context, cidr, tenantName, startIP, endIP, description string) (*reservedRange, error) {
+	defer logIfSlow(ctx, "ReserveRange", time.Now())
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		id          int64
+		bitmap      []byte
+		highWater   uint64
+		storedProbe bool
+	)
+	row := tx.QueryRowContext(ctx, "SELECT id, bitmap, high_water, probe_mode FROM subnets WHERE cidr = $1 AND tenant_name = $2 FOR UPDATE", cidr, tenantName)
+	if err := row.Scan(&id, &bitmap, &highWater, &storedProbe); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("CIDR %s is not registered for tenant %q; register it with POST /subnets first", cidr, tenantName)
+		}
+		return nil, err
+	}
+	if storedProbe {
+		return nil, fmt.Errorf("range reservations are not supported for %s: subnet is too large for bitmap allocation", cidr)
+	}
+
+	start := net.ParseIP(startIP)
+	end := net.ParseIP(endIP)
+	if start == nil || end == nil {
+		return nil, fmt.Errorf("invalid start/end IP address")
+	}
+	if !ipNet.Contains(start) || !ipNet.Contains(end) {
+		return nil, fmt.Errorf("range %s-%s is not contained in %s", startIP, endIP, cidr)
+	}
+
+	startOffset := ipOffset(start, ipNet.IP)
+	endOffset := ipOffset(end, ipNet.IP)
+	if startOffset > endOffset {
+		return nil, fmt.Errorf("start IP %s must come before end IP %s", startIP, endIP)
+	}
+
+	for offset := startOffset; offset <= endOffset; offset++ {
+		if bitSet(bitmap, offset) {
+			return nil, fmt.Errorf("range %s-%s overlaps an existing reservation in %s", startIP, endIP, cidr)
+		}
+	}
+	for offset := startOffset; offset <= endOffset; offset++ {
+		bitmap = setBit(bitmap, offset)
+	}
+	if endOffset+1 > highWater {
+		highWater = endOffset + 1
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE subnets SET bitmap = $1, high_water = $2 WHERE id = $3", bitmap, highWater, id); err != nil {
+		return nil, err
+	}
+
+	var rangeID int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO ip_ranges (cidr, tenant_name, start_ip, end_ip, description) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		ipNet.String(), tenantName, start.String(), end.String(), description).Scan(&rangeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &reservedRange{ID: rangeID, CIDR: ipNet.String(), TenantName: tenantName, StartIP: start.String(), EndIP: end.String(), Description: description}, nil
+}
+
+// IPExists reports whether ipAddress is currently reserved in cidr,
+// ignoring tenant like ListIPsInCIDR does; it backs GET /ip/{cidr}/{ip}.
+func (s *postgresStore) IPExists(ctx context.Context, cidr, ipAddress string) (bool, error) {
+	var exists int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM ips WHERE cidr = $1 AND ip_address = $2 LIMIT 1", cidr, ipAddress).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *postgresStore) CreateSubnet(ctx context.Context, cidr, tenantName, description string, parentID *int64) (*registeredSubnet, error) {
+	defer logIfSlow(ctx, "CreateSubnet", time.Now())
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	excludeIDs := map[int64]bool{}
+	if parentID != nil {
+		var parentCIDR string
+		row := tx.QueryRowContext(ctx, "SELECT cidr FROM subnets WHERE id = $1", *parentID)
+		if err := row.Scan(&parentCIDR); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("parent subnet %d not found", *parentID)
+			}
+			return nil, err
+		}
+		_, parentNet, err := net.ParseCIDR(parentCIDR)
+		if err != nil {
+			return nil, err
+		}
+		parentOnes, _ := parentNet.Mask.Size()
+		childOnes, _ := ipNet.Mask.Size()
+		if !parentNet.Contains(ipNet.IP) || childOnes < parentOnes {
+			return nil, fmt.Errorf("child CIDR %s is not contained in parent %s", cidr, parentCIDR)
+		}
+
+		excludeIDs, err = s.ancestorIDs(ctx, tx, *parentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkNoOverlap(ctx, tx, ipNet, tenantName, excludeIDs); err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO subnets (parent_id, cidr, tenant_name, description, bitmap, high_water, probe_mode) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		parentID, ipNet.String(), tenantName, description, []byte{}, 0, usesProbeMode(ipNet)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &registeredSubnet{ID: id, ParentID: parentID, CIDR: ipNet.String(), TenantName: tenantName, Description: description}, nil
+}
+
+// ancestorIDs walks the parent_id chain starting at id (inclusive),
+// returning the set of subnet ids a descendant is allowed to overlap
+// because it is, by construction, fully contained within them.
+func (s *postgresStore) ancestorIDs(ctx context.Context, tx *sql.Tx, id int64) (map[int64]bool, error) {
+	ids := map[int64]bool{}
+	for {
+		if ids[id] {
+			return nil, fmt.Errorf("cycle detected in subnet parent chain at id %d", id)
+		}
+		ids[id] = true
+
+		var parentID sql.NullInt64
+		row := tx.QueryRowContext(ctx, "SELECT parent_id FROM subnets WHERE id = $1", id)
+		if err := row.Scan(&parentID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("parent subnet %d not found", id)
+			}
+			return nil, err
+		}
+		if !parentID.Valid {
+			return ids, nil
+		}
+		id = parentID.Int64
+	}
+}
+
+// checkNoOverlap fails if candidate overlaps any subnet already registered
+// for tenantName, checking containment in both directions since either the
+// candidate or the existing subnet may be the larger prefix. excludeIDs is
+// the candidate's own ancestor chain (if any): a parent containing its
+// child is expected, not an overlap.
+func (s *postgresStore) checkNoOverlap(ctx context.Context, tx *sql.Tx, candidate *net.IPNet, tenantName string, excludeIDs map[int64]bool) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, cidr FROM subnets WHERE tenant_name = $1", tenantName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var existingCIDR string
+		if err := rows.Scan(&id, &existingCIDR); err != nil {
+			return err
+		}
+		if excludeIDs[id] {
+			continue
+		}
+		_, existingNet, err := net.ParseCIDR(existingCIDR)
+		if err != nil {
+			continue
+		}
+		if existingNet.Contains(candidate.IP) || candidate.Contains(existingNet.IP) {
+			return fmt.Errorf("CIDR %s overlaps existing subnet %s for tenant %q", candidate.String(), existingCIDR, tenantName)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *postgresStore) ListSubnets(ctx context.Context, tenantName string) ([]registeredSubnet, error) {
+	defer logIfSlow(ctx, "ListSubnets", time.Now())
+
+	query := "SELECT id, parent_id, cidr, tenant_name, description FROM subnets"
+	args := []interface{}{}
+	if tenantName != "" {
+		query += " WHERE tenant_name = $1"
+		args = append(args, tenantName)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subnets []registeredSubnet
+	for rows.Next() {
+		var sub registeredSubnet
+		var parentID sql.NullInt64
+		var description sql.NullString
+		if err := rows.Scan(&sub.ID, &parentID, &sub.CIDR, &sub.TenantName, &description); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			sub.ParentID = &parentID.Int64
+		}
+		sub.Description = description.String
+		subnets = append(subnets, sub)
+	}
+	return subnets, rows.Err()
+}
+
+func (s *postgresStore) DeleteSubnet(ctx context.Context, id int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM subnets WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s *postgresStore) SplitSubnet(ctx context.Context, parentID int64, childCIDR, description string) (*registeredSubnet, error) {
+	_, childNet, err := net.ParseCIDR(childCIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var parentCIDR, tenantName string
+	row := tx.QueryRowContext(ctx, "SELECT cidr, tenant_name FROM subnets WHERE id = $1", parentID)
+	if err := row.Scan(&parentCIDR, &tenantName); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("parent subnet %d not found", parentID)
+		}
+		return nil, err
+	}
+
+	_, parentNet, err := net.ParseCIDR(parentCIDR)
+	if err != nil {
+		return nil, err
+	}
+	parentOnes, _ := parentNet.Mask.Size()
+	childOnes, _ := childNet.Mask.Size()
+	if !parentNet.Contains(childNet.IP) || childOnes < parentOnes {
+		return nil, fmt.Errorf("child CIDR %s is not contained in parent %s", childCIDR, parentCIDR)
+	}
+
+	excludeIDs, err := s.ancestorIDs(ctx, tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkNoOverlap(ctx, tx, childNet, tenantName, excludeIDs); err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO subnets (parent_id, cidr, tenant_name, description, bitmap, high_water, probe_mode) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		parentID, childNet.String(), tenantName, description, []byte{}, 0, usesProbeMode(childNet)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	parent := parentID
+	return &registeredSubnet{ID: id, ParentID: &parent, CIDR: childNet.String(), TenantName: tenantName, Description: description}, nil
+}
+
+// SubnetUtilization reports the fraction of each subnet's address space
+// that's currently allocated, computed from the bitmap's population count.
+func (s *postgresStore) SubnetUtilization(ctx context.Context) ([]subnetUtilization, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT cidr, bitmap FROM subnets")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []subnetUtilization
+	for rows.Next() {
+		var cidr string
+		var bitmap []byte
+		if err := rows.Scan(&cidr, &bitmap); err != nil {
+			return nil, err
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		total, _ := new(big.Float).SetInt(addressCount(ipNet)).Float64()
+		result = append(result, subnetUtilization{CIDR: cidr, Used: countSetBits(bitmap), Total: total})
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// Recognized values for a reservation's "purpose" field. "gateway" and
+// "broadcast" pin a reservation to a specific address in the CIDR and may
+// only be reserved once per subnet; "vip" and "dns" are ordinary
+// reservations that just carry a tag and may be reserved any number of
+// times; "host" (or an empty purpose) is the default untagged reservation.
+const (
+	purposeHost      = "host"
+	purposeGateway   = "gateway"
+	purposeBroadcast = "broadcast"
+	purposeVIP       = "vip"
+	purposeDNS       = "dns"
+)
+
+var validPurposes = map[string]bool{
+	purposeHost:      true,
+	purposeGateway:   true,
+	purposeBroadcast: true,
+	purposeVIP:       true,
+	purposeDNS:       true,
+}
+
+// isValidPurpose reports whether purpose is a recognized value. An empty
+// purpose is valid and treated the same as "host".
+func isValidPurpose(purpose string) bool {
+	return purpose == "" || validPurposes[purpose]
+}
+
+// pinnedOffsetForPurpose returns the offset purpose must be allocated at
+// (the first usable address of ipNet for "gateway", the broadcast address
+// itself for "broadcast"), and whether purpose pins to a specific offset at
+// all. "host", "vip" and "dns" are unpinned and fall through to the normal
+// first-fit/probe search.
+func pinnedOffsetForPurpose(purpose string, ipNet *net.IPNet) (offset *big.Int, pinned bool) {
+	first, _ := reservedOffsets(ipNet)
+	switch purpose {
+	case purposeGateway:
+		return first, true
+	case purposeBroadcast:
+		return new(big.Int).Sub(addressCount(ipNet), big.NewInt(1)), true
+	default:
+		return nil, false
+	}
+}
+
+// offsetForReservation picks the offset to allocate for purpose: the fixed
+// offset for "gateway"/"broadcast" (erroring if it's already taken), or the
+// next free offset from the usual scan/probe search otherwise. taken
+// reports whether a candidate offset is already allocated; in probe mode
+// there's no bitmap to consult, so callers typically check the ips table.
+func offsetForReservation(state *subnetState, ipNet *net.IPNet, purpose string, taken func(offset *big.Int) (bool, error)) (*big.Int, error) {
+	offset, pinned := pinnedOffsetForPurpose(purpose, ipNet)
+	if !pinned {
+		return freeOffset(state, ipNet, taken)
+	}
+	isTaken, err := taken(offset)
+	if err != nil {
+		return nil, err
+	}
+	if isTaken {
+		return nil, fmt.Errorf("%w: %s", errPurposeAddressTaken, purpose)
+	}
+	return offset, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// reservedRange is the JSON representation of an ip_ranges row: a
+// contiguous block of addresses (e.g. a DHCP pool) carved out of a
+// registered subnet and excluded from individual IP allocation.
+type reservedRange struct {
+	ID          int64  `json:"id"`
+	CIDR        string `json:"cidr"`
+	TenantName  string `json:"tenant_name"`
+	StartIP     string `json:"start_ip"`
+	EndIP       string `json:"end_ip"`
+	Description string `json:"description,omitempty"`
+}
+
+// ReserveRangeHandler handles POST /reserve-range.
+func ReserveRangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	var requestPayload struct {
+		CIDR        string `json:"cidr"`
+		TenantName  string `json:"tenant_name"`
+		StartIP     string `json:"start_ip"`
+		EndIP       string `json:"end_ip"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestPayload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request payload")
+		return
+	}
+	setRequestTenantCIDR(r.Context(), requestPayload.TenantName, requestPayload.CIDR)
+
+	reserved, err := store.ReserveRange(r.Context(), requestPayload.CIDR, requestPayload.TenantName, requestPayload.StartIP, requestPayload.EndIP, requestPayload.Description)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "range_reservation_failed", fmt.Sprintf("Error reserving range: %s", err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reserved)
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore is the single-instance Store backend. Because SQLite only
+// ever has one writer at a time, it serializes the reservation critical
+// section with an in-process per-CIDR lock plus a BEGIN IMMEDIATE
+// transaction, and treats the ips table's UNIQUE constraint as the final
+// backstop if two connections still race.
+type sqliteStore struct {
+	db    *sql.DB
+	locks *lockManager
+}
+
+func newSQLiteStore(dsn string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqliteStore{db: db, locks: newLockManager()}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteStore) migrate() error {
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ips (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			cidr TEXT,
+			tenant_name TEXT,
+			ip_address TEXT,
+			purpose TEXT,
+			UNIQUE (cidr, tenant_name, ip_address)
+		)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS subnets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			parent_id INTEGER,
+			cidr TEXT NOT NULL,
+			tenant_name TEXT NOT NULL,
+			description TEXT,
+			bitmap BLOB,
+			high_water INTEGER NOT NULL DEFAULT 0,
+			probe_mode BOOLEAN NOT NULL DEFAULT 0,
+			UNIQUE (cidr, tenant_name)
+		)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ip_ranges (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			cidr TEXT NOT NULL,
+			tenant_name TEXT NOT NULL,
+			start_ip TEXT NOT NULL,
+			end_ip TEXT NOT NULL,
+			description TEXT
+		)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_ips_cidr_tenant ON ips (cidr, tenant_name)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_ips_ip_address ON ips (ip_address)`); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// maxReserveRetries bounds how many times ReserveIP retries the find+insert
+// transaction when it loses a race to another connection on the same CIDR
+// (the ips table's UNIQUE(cidr, tenant_name, ip_address) constraint is what
+// actually catches the race; the per-CIDR lock just makes retries rare).
+const maxReserveRetries = 5
+
+func (s *sqliteStore) ReserveIP(ctx context.Context, cidr, tenantName, purpose string) (string, bool, error) {
+	defer logIfSlow(ctx, "ReserveIP", time.Now())
+
+	unlock := s.locks.Lock(cidr)
+	defer unlock()
+
+	var lastErr error
+	for attempt := 0; attempt < maxReserveRetries; attempt++ {
+		ipString, err := s.tryReserveIP(ctx, cidr, tenantName, purpose)
+		if err == nil {
+			return ipString, true, nil
+		}
+		if !isUniqueConstraintError(err) {
+			return "", false, err
+		}
+		lastErr = err
+	}
+
+	return "", false, fmt.Errorf("failed to reserve IP in %s after %d attempts: %w", cidr, maxReserveRetries, lastErr)
+}
+
+// tryReserveIP runs a single find+insert attempt inside one BEGIN IMMEDIATE
+// transaction (db.Begin uses BEGIN IMMEDIATE because the DSN carries
+// _txlock=immediate), so another connection can't allocate the same offset
+// between the bitmap update and the ips row insert.
+func (s *sqliteStore) tryReserveIP(ctx context.Context, cidr, tenantName, purpose string) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	ip, err := s.allocateFromSubnet(ctx, tx, cidr, tenantName, purpose)
+	if err != nil {
+		return "", err
+	}
+	ipString := ip.String()
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO ips (cidr, tenant_name, ip_address, purpose) VALUES (?, ?, ?, ?)", cidr, tenantName, ipString, purpose); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return ipString, nil
+}
+
+func (s *sqliteStore) ReleaseIP(ctx context.Context, cidr, tenantName, ipAddress string) (bool, error) {
+	defer logIfSlow(ctx, "ReleaseIP", time.Now())
+
+	unlock := s.locks.Lock(cidr)
+	defer unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM ips WHERE cidr = ? AND tenant_name = ? AND ip_address = ?", cidr, tenantName, ipAddress)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected > 0 {
+		if err := s.releaseFromSubnet(ctx, tx, cidr, tenantName, ipAddress); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (s *sqliteStore) ListIPsInCIDR(ctx context.Context, cidr string) ([]string, error) {
+	defer logIfSlow(ctx, "ListIPsInCIDR", time.Now())
+
+	rows, err := s.db.QueryContext(ctx, "SELECT ip_address FROM ips WHERE cidr = ?", cidr)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ipAddress string
+		if err := rows.Scan(&ipAddress); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ipAddress)
+	}
+	return ips, rows.Err()
+}
+
+// IPExists reports whether ipAddress is currently reserved in cidr,
+// ignoring tenant like ListIPsInCIDR does; it backs GET /ip/{cidr}/{ip}.
+func (s *sqliteStore) IPExists(ctx context.Context, cidr, ipAddress string) (bool, error) {
+	var exists int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM ips WHERE cidr = ? AND ip_address = ? LIMIT 1", cidr, ipAddress).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// loadSubnetState looks up the subnets row for cidr/tenantName. The subnet
+// must already be registered via CreateSubnet; ReserveIP no longer creates
+// subnets implicitly, so that a typo'd CIDR fails fast instead of silently
+// allocating from an address plan nobody declared.
+func (s *sqliteStore) loadSubnetState(ctx context.Context, tx *sql.Tx, cidr, tenantName string) (*subnetState, *net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT id, bitmap, high_water, probe_mode FROM subnets WHERE cidr = ? AND tenant_name = ?", cidr, tenantName)
+
+	var (
+		id          int64
+		bitmap      []byte
+		highWater   uint64
+		storedProbe bool
+	)
+	err = row.Scan(&id, &bitmap, &highWater, &storedProbe)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("CIDR %s is not registered for tenant %q; register it with POST /subnets first", cidr, tenantName)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &subnetState{id: id, network: ipNet, total: addressCount(ipNet), bitmap: bitmap, highWater: highWater, probeMode: storedProbe}, ipNet, nil
+}
+
+// allocateFromSubnet finds a free offset in the subnet (past the high-water
+// mark for bitmap-backed subnets, or via randomized probing for subnets too
+// large to bitmap), marks it used, and returns the resulting IP. Must be
+// called inside a transaction; the caller is responsible for committing.
+func (s *sqliteStore) allocateFromSubnet(ctx context.Context, tx *sql.Tx, cidr, tenantName, purpose string) (net.IP, error) {
+	state, ipNet, err := s.loadSubnetState(ctx, tx, cidr, tenantName)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := offsetForReservation(state, ipNet, purpose, func(offset *big.Int) (bool, error) {
+		return s.offsetTaken(ctx, tx, cidr, state, ipNet, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Probe-mode subnets never get a bitmap: their offsets routinely exceed
+	// what offset.Uint64() can hold, and offsetTaken already consulted the
+	// ips table directly above.
+	if !state.probeMode {
+		offsetU64 := offset.Uint64()
+		byteIdx := offsetU64 / 8
+		grew := byteIdx >= uint64(len(state.bitmap))
+		state.bitmap = setBit(state.bitmap, offsetU64)
+		if offsetU64 >= state.highWater {
+			state.highWater = offsetU64 + 1
+		}
+
+		if err := s.persistBitAllocation(ctx, tx, state, byteIdx, grew); err != nil {
+			return nil, err
+		}
+	}
+
+	return addOffset(ipNet.IP, offset), nil
+}
+
+// persistBitAllocation writes state's bitmap/high_water back after a single
+// bit was set. When the bit fell within the bitmap's previous length
+// (!grew), only that one byte changed, so only that byte is sent rather
+// than rewriting the whole BLOB — a heavily-used /8 would otherwise push
+// ~2MB over the wire on every single reservation. grew is only true the
+// first time an allocation reaches a byte nobody has touched before, which
+// still requires writing the (now longer) bitmap in full.
+func (s *sqliteStore) persistBitAllocation(ctx context.Context, tx *sql.Tx, state *subnetState, byteIdx uint64, grew bool) error {
+	if grew {
+		_, err := tx.ExecContext(ctx, "UPDATE subnets SET bitmap = ?, high_water = ? WHERE id = ?", state.bitmap, state.highWater, state.id)
+		return err
+	}
+	_, err := tx.ExecContext(ctx,
+		"UPDATE subnets SET bitmap = substr(bitmap, 1, ?) || ? || substr(bitmap, ?), high_water = ? WHERE id = ?",
+		int64(byteIdx), state.bitmap[byteIdx:byteIdx+1], int64(byteIdx)+2, state.highWater, state.id)
+	return err
+}
+
+// offsetTaken reports whether offset is already allocated in ipNet. For
+// bitmap-backed subnets that's a cheap in-memory bit check; for probe-mode
+// subnets, which carry no bitmap, it queries the ips table for the address
+// offset maps to.
+func (s *sqliteStore) offsetTaken(ctx context.Context, tx *sql.Tx, cidr string, state *subnetState, ipNet *net.IPNet, offset *big.Int) (bool, error) {
+	if !state.probeMode {
+		return bitSet(state.bitmap, offset.Uint64()), nil
+	}
+
+	candidate := addOffset(ipNet.IP, offset).String()
+	var exists int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM ips WHERE cidr = ? AND ip_address = ? LIMIT 1", cidr, candidate).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseFromSubnet clears the bit for ip within cidr/tenantName, if the
+// subnet row exists. Probe-mode subnets carry no bitmap (their offsets are
+// never recorded in one; see allocateFromSubnet), so there's nothing to
+// clear there.
+func (s *sqliteStore) releaseFromSubnet(ctx context.Context, tx *sql.Tx, cidr, tenantName, ip string) error {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT id, bitmap, probe_mode FROM subnets WHERE cidr = ? AND tenant_name = ?", cidr, tenantName)
+	var (
+		id        int64
+		bitmap    []byte
+		probeMode bool
+	)
+	if err := row.Scan(&id, &bitmap, &probeMode); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if probeMode {
+		return nil
+	}
+
+	bitmap = clearBit(bitmap, ipOffset(parsed, ipNet.IP))
+
+	_, err = tx.ExecContext(ctx, "UPDATE subnets SET bitmap = ? WHERE id = ?", bitmap, id)
+	return err
+}
+
+// ReserveRange carves [startIP, endIP] out of cidr as a single reservation
+// (e.g. a DHCP pool), marking every offset in the range as allocated so
+// ReserveIP's scan/probe search skips them. It's only supported for
+// bitmap-backed subnets; probe-mode subnets are too large to mark a range
+// bit-by-bit.
+func (s *sqliteStore) ReserveRange(ctx context.Context, cidr, tenantName, startIP, endIP, description string) (*reservedRange, error) {
+	defer logIfSlow(ctx, "ReserveRange", time.Now())
+
+	unlock := s.locks.Lock(cidr)
+	defer unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	state, ipNet, err := s.loadSubnetState(ctx, tx, cidr, tenantName)
+	if err != nil {
+		return nil, err
+	}
+	if state.probeMode {
+		return nil, fmt.Errorf("range reservations are not supported for %s: subnet is too large for bitmap allocation", cidr)
+	}
+
+	start := net.ParseIP(startIP)
+	end := net.ParseIP(endIP)
+	if start == nil || end == nil {
+		return nil, fmt.Errorf("invalid start/end IP address")
+	}
+	if !ipNet.Contains(start) || !ipNet.Contains(end) {
+		return nil, fmt.Errorf("range %s-%s is not contained in %s", startIP, endIP, cidr)
+	}
+
+	startOffset := ipOffset(start, ipNet.IP)
+	endOffset := ipOffset(end, ipNet.IP)
+	if startOffset > endOffset {
+		return nil, fmt.Errorf("start IP %s must come before end IP %s", startIP, endIP)
+	}
+
+	for offset := startOffset; offset <= endOffset; offset++ {
+		if bitSet(state.bitmap, offset) {
+			return nil, fmt.Errorf("range %s-%s overlaps an existing reservation in %s", startIP, endIP, cidr)
+		}
+	}
+	for offset := startOffset; offset <= endOffset; offset++ {
+		state.bitmap = setBit(state.bitmap, offset)
+	}
+	if endOffset+1 > state.highWater {
+		state.highWater = endOffset + 1
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE subnets SET bitmap = ?, high_water = ? WHERE id = ?", state.bitmap, state.highWater, state.id); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO ip_ranges (cidr, tenant_name, start_ip, end_ip, description) VALUES (?, ?, ?, ?, ?)",
+		ipNet.String(), tenantName, start.String(), end.String(), description)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &reservedRange{ID: id, CIDR: ipNet.String(), TenantName: tenantName, StartIP: start.String(), EndIP: end.String(), Description: description}, nil
+}
+
+func (s *sqliteStore) CreateSubnet(ctx context.Context, cidr, tenantName, description string, parentID *int64) (*registeredSubnet, error) {
+	defer logIfSlow(ctx, "CreateSubnet", time.Now())
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	excludeIDs := map[int64]bool{}
+	if parentID != nil {
+		var parentCIDR string
+		row := tx.QueryRowContext(ctx, "SELECT cidr FROM subnets WHERE id = ?", *parentID)
+		if err := row.Scan(&parentCIDR); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("parent subnet %d not found", *parentID)
+			}
+			return nil, err
+		}
+		_, parentNet, err := net.ParseCIDR(parentCIDR)
+		if err != nil {
+			return nil, err
+		}
+		parentOnes, _ := parentNet.Mask.Size()
+		childOnes, _ := ipNet.Mask.Size()
+		if !parentNet.Contains(ipNet.IP) || childOnes < parentOnes {
+			return nil, fmt.Errorf("child CIDR %s is not contained in parent %s", cidr, parentCIDR)
+		}
+
+		excludeIDs, err = s.ancestorIDs(ctx, tx, *parentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkNoOverlap(ctx, tx, ipNet, tenantName, excludeIDs); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO subnets (parent_id, cidr, tenant_name, description, bitmap, high_water, probe_mode) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		parentID, ipNet.String(), tenantName, description, []byte{}, 0, usesProbeMode(ipNet))
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &registeredSubnet{ID: id, ParentID: parentID, CIDR: ipNet.String(), TenantName: tenantName, Description: description}, nil
+}
+
+// ancestorIDs walks the parent_id chain starting at id (inclusive),
+// returning the set of subnet ids a descendant is allowed to overlap
+// because it is, by construction, fully contained within them.
+func (s *sqliteStore) ancestorIDs(ctx context.Context, tx *sql.Tx, id int64) (map[int64]bool, error) {
+	ids := map[int64]bool{}
+	for {
+		if ids[id] {
+			return nil, fmt.Errorf("cycle detected in subnet parent chain at id %d", id)
+		}
+		ids[id] = true
+
+		var parentID sql.NullInt64
+		row := tx.QueryRowContext(ctx, "SELECT parent_id FROM subnets WHERE id = ?", id)
+		if err := row.Scan(&parentID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("parent subnet %d not found", id)
+			}
+			return nil, err
+		}
+		if !parentID.Valid {
+			return ids, nil
+		}
+		id = parentID.Int64
+	}
+}
+
+// checkNoOverlap fails if candidate overlaps any subnet already registered
+// for tenantName, checking containment in both directions since either the
+// candidate or the existing subnet may be the larger prefix. excludeIDs is
+// the candidate's own ancestor chain (if any): a parent containing its
+// child is expected, not an overlap.
+func (s *sqliteStore) checkNoOverlap(ctx context.Context, tx *sql.Tx, candidate *net.IPNet, tenantName string, excludeIDs map[int64]bool) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, cidr FROM subnets WHERE tenant_name = ?", tenantName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var existingCIDR string
+		if err := rows.Scan(&id, &existingCIDR); err != nil {
+			return err
+		}
+		if excludeIDs[id] {
+			continue
+		}
+		_, existingNet, err := net.ParseCIDR(existingCIDR)
+		if err != nil {
+			continue
+		}
+		if existingNet.Contains(candidate.IP) || candidate.Contains(existingNet.IP) {
+			return fmt.Errorf("CIDR %s overlaps existing subnet %s for tenant %q", candidate.String(), existingCIDR, tenantName)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) ListSubnets(ctx context.Context, tenantName string) ([]registeredSubnet, error) {
+	defer logIfSlow(ctx, "ListSubnets", time.Now())
+
+	query := "SELECT id, parent_id, cidr, tenant_name, description FROM subnets"
+	args := []interface{}{}
+	if tenantName != "" {
+		query += " WHERE tenant_name = ?"
+		args = append(args, tenantName)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subnets []registeredSubnet
+	for rows.Next() {
+		var sub registeredSubnet
+		var parentID sql.NullInt64
+		var description sql.NullString
+		if err := rows.Scan(&sub.ID, &parentID, &sub.CIDR, &sub.TenantName, &description); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			sub.ParentID = &parentID.Int64
+		}
+		sub.Description = description.String
+		subnets = append(subnets, sub)
+	}
+	return subnets, rows.Err()
+}
+
+func (s *sqliteStore) DeleteSubnet(ctx context.Context, id int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM subnets WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// SplitSubnet carves a child prefix out of parentID's CIDR, rejecting the
+// split if childCIDR isn't contained in the parent or overlaps an existing
+// sibling.
+func (s *sqliteStore) SplitSubnet(ctx context.Context, parentID int64, childCIDR, description string) (*registeredSubnet, error) {
+	_, childNet, err := net.ParseCIDR(childCIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var parentCIDR, tenantName string
+	row := tx.QueryRowContext(ctx, "SELECT cidr, tenant_name FROM subnets WHERE id = ?", parentID)
+	if err := row.Scan(&parentCIDR, &tenantName); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("parent subnet %d not found", parentID)
+		}
+		return nil, err
+	}
+
+	_, parentNet, err := net.ParseCIDR(parentCIDR)
+	if err != nil {
+		return nil, err
+	}
+	parentOnes, _ := parentNet.Mask.Size()
+	childOnes, _ := childNet.Mask.Size()
+	if !parentNet.Contains(childNet.IP) || childOnes < parentOnes {
+		return nil, fmt.Errorf("child CIDR %s is not contained in parent %s", childCIDR, parentCIDR)
+	}
+
+	excludeIDs, err := s.ancestorIDs(ctx, tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkNoOverlap(ctx, tx, childNet, tenantName, excludeIDs); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO subnets (parent_id, cidr, tenant_name, description, bitmap, high_water, probe_mode) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		parentID, childNet.String(), tenantName, description, []byte{}, 0, usesProbeMode(childNet))
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	parent := parentID
+	return &registeredSubnet{ID: id, ParentID: &parent, CIDR: childNet.String(), TenantName: tenantName, Description: description}, nil
+}
+
+// SubnetUtilization reports the fraction of each subnet's address space
+// that's currently allocated, computed from the bitmap's population count
+// so releases are reflected immediately (unlike the high-water mark, which
+// only ever moves forward).
+func (s *sqliteStore) SubnetUtilization(ctx context.Context) ([]subnetUtilization, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT cidr, bitmap FROM subnets")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []subnetUtilization
+	for rows.Next() {
+		var cidr string
+		var bitmap []byte
+		if err := rows.Scan(&cidr, &bitmap); err != nil {
+			return nil, err
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		total, _ := new(big.Float).SetInt(addressCount(ipNet)).Float64()
+		result = append(result, subnetUtilization{CIDR: cidr, Used: countSetBits(bitmap), Total: total})
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Store is the persistence layer the HTTP handlers talk to. It hides the
+// SQL dialect (and therefore the locking strategy used to keep reservation
+// races out) behind a single interface so the server can run against
+// SQLite for a single instance or PostgreSQL for multiple instances behind
+// a load balancer. Every method but Close takes the request's context so the
+// request_id the logging middleware generates can be attached to slow
+// query logs down in the store.
+type Store interface {
+	ReserveIP(ctx context.Context, cidr, tenantName, purpose string) (string, bool, error)
+	ReleaseIP(ctx context.Context, cidr, tenantName, ipAddress string) (bool, error)
+	ListIPsInCIDR(ctx context.Context, cidr string) ([]string, error)
+	IPExists(ctx context.Context, cidr, ipAddress string) (bool, error)
+	ReserveRange(ctx context.Context, cidr, tenantName, startIP, endIP, description string) (*reservedRange, error)
+
+	CreateSubnet(ctx context.Context, cidr, tenantName, description string, parentID *int64) (*registeredSubnet, error)
+	ListSubnets(ctx context.Context, tenantName string) ([]registeredSubnet, error)
+	DeleteSubnet(ctx context.Context, id int64) (bool, error)
+	SplitSubnet(ctx context.Context, parentID int64, childCIDR, description string) (*registeredSubnet, error)
+
+	// SubnetUtilization reports, for every registered subnet, how many of
+	// its addresses are allocated. It backs the ipam_subnet_utilization
+	// gauge, which is computed fresh on every /metrics scrape. The count
+	// comes from each subnet's allocation bitmap; probe-mode subnets keep no
+	// bitmap, so they are always reported with zero addresses allocated.
+	SubnetUtilization(ctx context.Context) ([]subnetUtilization, error)
+
+	Close() error
+}
+
+// subnetUtilization is one row of SubnetUtilization's result. Total is a
+// float64 (rather than big.Int) because it only ever feeds a Prometheus
+// gauge, which is float64-valued anyway.
+type subnetUtilization struct {
+	CIDR  string
+	Used  uint64
+	Total float64
+}
+
+// NewStore opens a Store for the driver named by the IPAM_DB_DRIVER env var
+// ("sqlite3", the default, or "postgres"), connecting with IPAM_DB_DSN.
+// Each implementation runs its own idempotent schema migration on open.
+func NewStore() (Store, error) {
+	driver := os.Getenv("IPAM_DB_DRIVER")
+	if driver == "" {
+		driver = "sqlite3"
+	}
+	dsn := os.Getenv("IPAM_DB_DSN")
+
+	switch driver {
+	case "sqlite3":
+		if dsn == "" {
+			dsn = "ip_database.db?_txlock=immediate"
+		}
+		return newSQLiteStore(dsn)
+	case "postgres":
+		if dsn == "" {
+			return nil, fmt.Errorf("IPAM_DB_DSN is required for the postgres driver")
+		}
+		return newPostgresStore(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported IPAM_DB_DRIVER %q (expected sqlite3 or postgres)", driver)
+	}
+}
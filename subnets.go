@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// registeredSubnet is the JSON representation of a subnets row returned by
+// the registration API. The bitmap/high_water allocator state is internal
+// and intentionally not exposed here.
+type registeredSubnet struct {
+	ID          int64  `json:"id"`
+	ParentID    *int64 `json:"parent_id,omitempty"`
+	CIDR        string `json:"cidr"`
+	TenantName  string `json:"tenant_name"`
+	Description string `json:"description,omitempty"`
+}
+
+// SubnetsHandler routes /subnets to the create/list handlers; SubnetByIDHandler
+// (registered separately) covers /subnets/{id} and /subnets/{id}/split.
+func SubnetsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		createSubnetHandler(w, r)
+	case http.MethodGet:
+		listSubnetsHandler(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// SubnetByIDHandler handles DELETE /subnets/{id} and POST /subnets/{id}/split.
+func SubnetByIDHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/subnets/")
+	idPart, action, hasAction := strings.Cut(path, "/")
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid subnet id")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodDelete && !hasAction:
+		deleteSubnetHandler(w, r, id)
+	case r.Method == http.MethodPost && hasAction && action == "split":
+		splitSubnetHandler(w, r, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func createSubnetHandler(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		CIDR        string `json:"cidr"`
+		TenantName  string `json:"tenant_name"`
+		Description string `json:"description"`
+		ParentID    *int64 `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestPayload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request payload")
+		return
+	}
+
+	subnet, err := store.CreateSubnet(r.Context(), requestPayload.CIDR, requestPayload.TenantName, requestPayload.Description, requestPayload.ParentID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "subnet_registration_failed", fmt.Sprintf("Error registering subnet: %s", err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subnet)
+}
+
+func listSubnetsHandler(w http.ResponseWriter, r *http.Request) {
+	tenantName := r.URL.Query().Get("tenant_name")
+
+	subnets, err := store.ListSubnets(r.Context(), tenantName)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "subnet_list_failed", fmt.Sprintf("Error listing subnets: %s", err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Subnets []registeredSubnet `json:"subnets"`
+	}{Subnets: subnets})
+}
+
+func deleteSubnetHandler(w http.ResponseWriter, r *http.Request, id int64) {
+	deleted, err := store.DeleteSubnet(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "subnet_delete_failed", fmt.Sprintf("Error deleting subnet: %s", err.Error()))
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, "subnet_not_found", "Subnet not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Success bool `json:"success"`
+	}{Success: true})
+}
+
+func splitSubnetHandler(w http.ResponseWriter, r *http.Request, parentID int64) {
+	var requestPayload struct {
+		CIDR        string `json:"cidr"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestPayload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request payload")
+		return
+	}
+
+	child, err := store.SplitSubnet(r.Context(), parentID, requestPayload.CIDR, requestPayload.Description)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "subnet_split_failed", fmt.Sprintf("Error splitting subnet: %s", err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, child)
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	responseJSON, err := json.Marshal(payload)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "encoding_failed", "Error encoding JSON")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
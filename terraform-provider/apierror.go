@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// apiError mirrors the server's {"error":"...","code":"..."} error body.
+type apiError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// diagFromResponse turns a non-2xx API response into a diag.Diagnostics,
+// pointing at attr (if non-empty) so `terraform plan` output highlights the
+// offending argument instead of a bare error string. Falls back to the raw
+// response body if it isn't the server's structured error JSON.
+func diagFromResponse(resp *http.Response, attr string) diag.Diagnostics {
+	body, _ := io.ReadAll(resp.Body)
+
+	var apiErr apiError
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Error == "" {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("API request failed with status %d", resp.StatusCode),
+			Detail:   string(body),
+		}}
+	}
+
+	d := diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  apiErr.Error,
+		Detail:   fmt.Sprintf("server returned code %q (HTTP %d)", apiErr.Code, resp.StatusCode),
+	}
+	if attr != "" {
+		d.AttributePath = cty.GetAttrPath(attr)
+	}
+	return diag.Diagnostics{d}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceIPRange() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceIPRangeCreate,
+		ReadContext:   resourceIPRangeRead,
+		DeleteContext: resourceIPRangeDelete,
+		Schema: map[string]*schema.Schema{
+			"cidr": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The CIDR the range is carved out of",
+			},
+			"tenant_name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the tenant this range belongs to",
+			},
+			"start_ip": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The first address in the range",
+			},
+			"end_ip": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The last address in the range",
+			},
+			"description": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "A human-readable description of the range, e.g. its DHCP pool name",
+			},
+		},
+	}
+}
+
+func resourceIPRangeCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	cfg := m.(*providerConfig)
+
+	requestPayload := map[string]string{
+		"cidr":        d.Get("cidr").(string),
+		"tenant_name": d.Get("tenant_name").(string),
+		"start_ip":    d.Get("start_ip").(string),
+		"end_ip":      d.Get("end_ip").(string),
+		"description": d.Get("description").(string),
+	}
+
+	resp, err := cfg.request(ctx, http.MethodPost, "/reserve-range", requestPayload)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to reserve range: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return diagFromResponse(resp, "cidr")
+	}
+
+	var ipRange struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ipRange); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode response body: %s", err))
+	}
+
+	d.SetId(strconv.FormatInt(ipRange.ID, 10))
+	return nil
+}
+
+func resourceIPRangeRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	// The server has no GET for individual ranges; the range was created
+	// with ForceNew fields only, so there's nothing that can drift short of
+	// the range being deleted out-of-band, which this resource cannot
+	// detect (unlike the IP reservation and subnet resources, whose Read
+	// clears the id when the server no longer has them).
+	return nil
+}
+
+func resourceIPRangeDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	// The server has no endpoint to release a range reservation; removing
+	// it from Terraform state does not free the addresses.
+	d.SetId("")
+	return nil
+}
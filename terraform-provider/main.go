@@ -5,15 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	_ "log"
 	"net/http"
+	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 )
 
+// validPurposes mirrors the server's recognized reservation purposes, so
+// a typo'd purpose fails at `terraform plan` instead of a 400 from the API.
+var validPurposes = []string{"host", "gateway", "broadcast", "vip", "dns"}
+
 func main() {
 	plugin.Serve(&plugin.ServeOpts{
 		ProviderFunc: func() *schema.Provider {
@@ -30,24 +36,60 @@ func provider() *schema.Provider {
 				Required:    true,
 				Description: "The URL of the IP reservation API server",
 			},
+			"api_token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "Bearer token sent with every request to the IP reservation API",
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"ipam-test_ip_reservation": resourceIP(),
+			"ipam-test_subnet":         resourceSubnet(),
+			"ipam-test_ip_range":       resourceIPRange(),
 		},
 		ConfigureContextFunc: configureProvider,
 	}
 }
 
 func configureProvider(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
-	serverURL := d.Get("server_url").(string)
-
 	return &providerConfig{
-		ServerURL: serverURL,
+		ServerURL: d.Get("server_url").(string),
+		APIToken:  d.Get("api_token").(string),
 	}, nil
 }
 
 type providerConfig struct {
 	ServerURL string
+	APIToken  string
+}
+
+// request issues method to path (relative to ServerURL), JSON-encoding
+// payload as the body when non-nil, and attaching the Bearer token when the
+// provider was configured with one. Callers are responsible for closing the
+// response body.
+func (c *providerConfig) request(ctx context.Context, method, path string, payload interface{}) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.ServerURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIToken)
+	}
+
+	return http.DefaultClient.Do(req)
 }
 
 func resourceIP() *schema.Resource {
@@ -55,6 +97,9 @@ func resourceIP() *schema.Resource {
 		CreateContext: resourceIPCreate,
 		ReadContext:   resourceIPRead,
 		DeleteContext: resourceIPDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceIPImport,
+		},
 		Schema: map[string]*schema.Schema{
 			"cidr": {
 				Type:        schema.TypeString,
@@ -69,10 +114,11 @@ func resourceIP() *schema.Resource {
 				Description: "The name of the tenant",
 			},
 			"purpose": {
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "The purpose of the IP (host, gateway, dns, vip)",
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				Description:  "The purpose of the IP (host, gateway, broadcast, dns, vip)",
+				ValidateFunc: validation.StringInSlice(validPurposes, false),
 			},
 			"ip_address": {
 				Type:        schema.TypeString,
@@ -84,20 +130,14 @@ func resourceIP() *schema.Resource {
 }
 
 func resourceIPCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	serverURL := m.(*providerConfig).ServerURL
+	cfg := m.(*providerConfig)
 	cidr := d.Get("cidr").(string)
 	tenantName := d.Get("tenant_name").(string)
 	purpose := d.Get("purpose").(string)
 
-	// Validate the state of IP addresses in the subnet
-	//if err := validateIPState(serverURL, cidr); err != nil {
-	//	return diag.FromErr(fmt.Errorf("failed to validate IP state: %s", err))
-	//}
-
-	// Proceed with reserving the IP address
-	ipAddress, err := reserveIP(serverURL, cidr, tenantName, purpose)
-	if err != nil {
-		return diag.FromErr(fmt.Errorf("failed to reserve IP: %s", err))
+	ipAddress, diags := reserveIP(ctx, cfg, cidr, tenantName, purpose)
+	if diags != nil {
+		return diags
 	}
 
 	d.SetId(ipAddress)
@@ -106,151 +146,99 @@ func resourceIPCreate(ctx context.Context, d *schema.ResourceData, m interface{}
 	return nil
 }
 
+// resourceIPRead checks GET /ip/{cidr}/{ip} and clears the resource's id
+// when the server reports the address is no longer reserved, so Terraform
+// treats an out-of-band release as drift instead of an error.
 func resourceIPRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	serverURL := m.(*providerConfig).ServerURL
+	cfg := m.(*providerConfig)
 	cidr := d.Get("cidr").(string)
-	//tenantName := d.Get("tenant_name").(string)
-	ipAddress := d.Get("ip_address").(string)
+	ipAddress := d.Id()
 
-	// Make the HTTP GET request to the get-ips-in-subnet endpoint
-	resp, err := http.Get(fmt.Sprintf("%s/get-ips-in-subnet?subnet=%s", serverURL, cidr))
+	resp, err := cfg.request(ctx, http.MethodGet, fmt.Sprintf("/ip/%s/%s", cidr, ipAddress), nil)
 	if err != nil {
-		return diag.FromErr(fmt.Errorf("failed to fetch IPs in subnet: %s", err))
+		return diag.FromErr(fmt.Errorf("failed to check IP reservation: %s", err))
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return diag.FromErr(fmt.Errorf("failed to fetch IPs in subnet, status code: %d", resp.StatusCode))
+	if resp.StatusCode == http.StatusNotFound {
+		d.SetId("")
+		return nil
 	}
-
-	var response struct {
-		IPs []string `json:"ips"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return diag.FromErr(fmt.Errorf("failed to decode response body: %s", err))
-	}
-
-	// Check if the IP exists in the subnet
-	ipExists := false
-	for _, ip := range response.IPs {
-		if ip == ipAddress {
-			ipExists = true
-			break
-		}
-	}
-
-	if !ipExists {
-		return diag.Errorf("IP address %s does not exist in subnet %s", ipAddress, cidr)
+	if resp.StatusCode != http.StatusOK {
+		return diagFromResponse(resp, "cidr")
 	}
 
+	d.Set("ip_address", ipAddress)
 	return nil
 }
 
 func resourceIPDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	serverURL := m.(*providerConfig).ServerURL
+	cfg := m.(*providerConfig)
 	cidr := d.Get("cidr").(string)
 	tenantName := d.Get("tenant_name").(string)
 	ipAddress := d.Id()
 
-	err := releaseIP(serverURL, cidr, tenantName, ipAddress)
-	if err != nil {
-		return diag.FromErr(fmt.Errorf("failed to release IP: %s", err))
+	return releaseIP(ctx, cfg, cidr, tenantName, ipAddress)
+}
+
+// resourceIPImport parses a "cidr|tenant|ip" import id so a reservation
+// made outside Terraform (or by an older provider version, before this
+// resource had an Importer) can be brought under management. The purpose
+// the reservation was created with isn't recoverable from the API, so it's
+// left for the user's configuration to supply.
+func resourceIPImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), "|", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("import id must be in the form cidr|tenant|ip, got %q", d.Id())
 	}
+	cidr, tenantName, ipAddress := parts[0], parts[1], parts[2]
 
-	return nil
-}
+	d.Set("cidr", cidr)
+	d.Set("tenant_name", tenantName)
+	d.Set("ip_address", ipAddress)
+	d.SetId(ipAddress)
 
-//func validateIPState(serverURL, subnet string) error {
-//	resp, err := http.Get(fmt.Sprintf("%s/get-ips-in-subnet?subnet=%s", serverURL, subnet))
-//	if err != nil {
-//		return err
-//	}
-//	defer resp.Body.Close()
-//
-//	if resp.StatusCode != http.StatusOK {
-//		return fmt.Errorf("failed to validate IP state, status code: %d", resp.StatusCode)
-//	}
-//
-//	var response struct {
-//		IPs []string `json:"ips"`
-//	}
-//
-//	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-//		return fmt.Errorf("failed to decode response body: %s", err)
-//	}
-//
-//	// Check if the subnet is already at capacity (you can customize this logic)
-//	if len(response.IPs) >= 255 {
-//		return fmt.Errorf("subnet %s is at capacity", subnet)
-//	}
-//
-//	return nil
-//}
+	return []*schema.ResourceData{d}, nil
+}
 
-func reserveIP(serverURL, cidr, tenantName, purpose string) (string, error) {
-	// Prepare the request payload
-	requestPayload := map[string]string{
-		"cidr":       cidr,
+func reserveIP(ctx context.Context, cfg *providerConfig, cidr, tenantName, purpose string) (string, diag.Diagnostics) {
+	resp, err := cfg.request(ctx, http.MethodPost, "/reserve-ip", map[string]string{
+		"cidr":        cidr,
 		"tenant_name": tenantName,
-		"purpose":    purpose,
-	}
-	payloadBytes, err := json.Marshal(requestPayload)
-	if err != nil {
-		return "", err
-	}
-
-	// Make the HTTP POST request to reserve-ip endpoint
-	resp, err := http.Post(serverURL+"/reserve-ip", "application/json", bytes.NewBuffer(payloadBytes))
+		"purpose":     purpose,
+	})
 	if err != nil {
-		return "", err
+		return "", diag.FromErr(fmt.Errorf("failed to reserve IP: %s", err))
 	}
 	defer resp.Body.Close()
 
-	// Check the response status code
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to reserve IP, status code: %d", resp.StatusCode)
-	}
-
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+		return "", diagFromResponse(resp, "purpose")
 	}
 
-	// Parse the response JSON
 	var response struct {
 		IPAddress string `json:"ip_address"`
 	}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return "", err
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", diag.FromErr(fmt.Errorf("failed to decode response body: %s", err))
 	}
 
 	return response.IPAddress, nil
 }
 
-func releaseIP(serverURL, cidr, tenantName, ipAddress string) error {
-	// Prepare the request payload
-	requestPayload := map[string]string{
+func releaseIP(ctx context.Context, cfg *providerConfig, cidr, tenantName, ipAddress string) diag.Diagnostics {
+	resp, err := cfg.request(ctx, http.MethodPost, "/release-ip", map[string]string{
 		"cidr":        cidr,
 		"tenant_name": tenantName,
 		"ip_address":  ipAddress,
-	}
-	payloadBytes, err := json.Marshal(requestPayload)
-	if err != nil {
-		return err
-	}
-
-	// Make the HTTP POST request to release-ip endpoint
-	resp, err := http.Post(serverURL+"/release-ip", "application/json", bytes.NewBuffer(payloadBytes))
+	})
 	if err != nil {
-		return err
+		return diag.FromErr(fmt.Errorf("failed to release IP: %s", err))
 	}
 	defer resp.Body.Close()
 
-	// Check the response status code
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to release IP, status code: %d", resp.StatusCode)
+		return diagFromResponse(resp, "cidr")
 	}
 
 	return nil
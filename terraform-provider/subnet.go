@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceSubnet() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceSubnetCreate,
+		ReadContext:   resourceSubnetRead,
+		DeleteContext: resourceSubnetDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"cidr": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The CIDR notation for the subnet",
+			},
+			"tenant_name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the tenant this subnet belongs to",
+			},
+			"description": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "A human-readable description of the subnet",
+			},
+			"parent_id": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "The id of the parent subnet this was split from, if any",
+			},
+		},
+	}
+}
+
+func resourceSubnetCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	cfg := m.(*providerConfig)
+
+	requestPayload := map[string]interface{}{
+		"cidr":        d.Get("cidr").(string),
+		"tenant_name": d.Get("tenant_name").(string),
+		"description": d.Get("description").(string),
+	}
+	if parentID, ok := d.GetOk("parent_id"); ok {
+		requestPayload["parent_id"] = parentID.(int)
+	}
+
+	resp, err := cfg.request(ctx, http.MethodPost, "/subnets", requestPayload)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to register subnet: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return diagFromResponse(resp, "cidr")
+	}
+
+	var subnet struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&subnet); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode response body: %s", err))
+	}
+
+	d.SetId(strconv.FormatInt(subnet.ID, 10))
+	return nil
+}
+
+func resourceSubnetRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	cfg := m.(*providerConfig)
+	tenantName := d.Get("tenant_name").(string)
+
+	resp, err := cfg.request(ctx, http.MethodGet, fmt.Sprintf("/subnets?tenant_name=%s", tenantName), nil)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to fetch subnets: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return diagFromResponse(resp, "tenant_name")
+	}
+
+	var response struct {
+		Subnets []struct {
+			ID          int64  `json:"id"`
+			CIDR        string `json:"cidr"`
+			TenantName  string `json:"tenant_name"`
+			Description string `json:"description"`
+			ParentID    *int64 `json:"parent_id"`
+		} `json:"subnets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode response body: %s", err))
+	}
+
+	for _, s := range response.Subnets {
+		if strconv.FormatInt(s.ID, 10) == d.Id() {
+			d.Set("cidr", s.CIDR)
+			d.Set("tenant_name", s.TenantName)
+			d.Set("description", s.Description)
+			if s.ParentID != nil {
+				d.Set("parent_id", *s.ParentID)
+			}
+			return nil
+		}
+	}
+
+	// Not found: clear the id so Terraform knows it's gone rather than erroring.
+	d.SetId("")
+	return nil
+}
+
+func resourceSubnetDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	cfg := m.(*providerConfig)
+
+	resp, err := cfg.request(ctx, http.MethodDelete, fmt.Sprintf("/subnets/%s", d.Id()), nil)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to delete subnet: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return diagFromResponse(resp, "")
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// slowQueryThreshold is how long a store call may take before it's worth a
+// dedicated log line tying it back to the request that issued it.
+const slowQueryThreshold = 200 * time.Millisecond
+
+// logIfSlow logs label's duration since start, tagged with the request_id
+// carried on ctx, when it exceeds slowQueryThreshold. Called via
+// `defer logIfSlow(ctx, "ReserveIP", time.Now())` at the top of Store
+// methods.
+func logIfSlow(ctx context.Context, label string, start time.Time) {
+	elapsed := time.Since(start)
+	if elapsed <= slowQueryThreshold {
+		return
+	}
+	log.Printf(`{"request_id":%q,"slow_query":%q,"duration_ms":%d}`, requestIDFromContext(ctx), label, elapsed.Milliseconds())
+}